@@ -0,0 +1,22 @@
+package client
+
+import "errors"
+
+// Typed errors ExecCommand can return, so callers can distinguish "nobody
+// answered" from "the network lied to us" instead of pattern-matching on a
+// generic error string. ExecCommand returns whichever of ErrLeaderUnavailable
+// and ErrBadSignature it recorded last, and ErrNoQuorum only when it recorded
+// neither.
+var (
+	// ErrNoQuorum means fewer than a majority of group members returned a
+	// validly-signed, matching response before every retry was exhausted.
+	ErrNoQuorum = errors.New("bftraft: did not collect a quorum of matching signed responses")
+	// ErrLeaderUnavailable means the group's leader could not be resolved on
+	// at least one attempt and no attempt reached quorum. A leader that
+	// answers NotLeader or times out is re-resolved on the next attempt and
+	// does not by itself produce this error.
+	ErrLeaderUnavailable = errors.New("bftraft: leader unavailable after retries")
+	// ErrBadSignature means a CommandResponse was discarded because its
+	// signature did not verify against the sender's known public key.
+	ErrBadSignature = errors.New("bftraft: command response signature did not verify")
+)
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	spb "github.com/PomeloCloud/BFTRaft4go/proto/server"
+	"github.com/PomeloCloud/BFTRaft4go/utils"
+	"github.com/patrickmn/go-cache"
+)
+
+// ODRBackend is an on-demand-retrieval source for group state: it fetches a
+// signed header plus a Merkle proof for a single leaf from whatever peer it
+// is configured to talk to. Implementations may retry against a fallback
+// list when the primary peer is unreachable or returns a bad proof.
+type ODRBackend interface {
+	FetchProof(ctx context.Context, groupId uint64, leafIndex int) (*spb.ProofResponse, error)
+}
+
+// singlePeerODR retrieves proofs from one preferred peer, falling back to the
+// next address in Fallbacks on error so a light client keeps working while
+// its primary source is down.
+type singlePeerODR struct {
+	Primary   string
+	Fallbacks []string
+}
+
+func NewSinglePeerODR(primary string, fallbacks []string) ODRBackend {
+	return &singlePeerODR{Primary: primary, Fallbacks: fallbacks}
+}
+
+func (o *singlePeerODR) FetchProof(ctx context.Context, groupId uint64, leafIndex int) (*spb.ProofResponse, error) {
+	addrs := append([]string{o.Primary}, o.Fallbacks...)
+	var lastErr error
+	for _, addr := range addrs {
+		rpc, err := utils.GetClusterRPC(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res, err := rpc.GetProof(ctx, &spb.ProofRequest{GroupId: groupId, LeafIndex: int32(leafIndex)})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return res, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no ODR backend available")
+	}
+	return nil, lastErr
+}
+
+type odrRequest struct {
+	done chan struct{}
+	res  *spb.ProofResponse
+	err  error
+}
+
+// LightClient verifies group state via quorum-signed Merkle proofs instead of
+// polling every alpha node for a majority response, so it can participate in
+// the network while only ever talking to a single nearby peer.
+type LightClient struct {
+	// GroupPeerPubKeys is every group's known peers' public keys, keyed by
+	// group id then peer (host) id, provisioned out of band. A proof's
+	// QuorumSignatures are checked against this set so no single signer,
+	// however many bytes it signs, can satisfy quorum on its own.
+	GroupPeerPubKeys map[uint64]map[uint64][]byte
+	Backend          ODRBackend
+	ProofCache       *cache.Cache
+
+	coalesceLock sync.Mutex
+	inflight     map[string]*odrRequest
+}
+
+func NewLightClient(backend ODRBackend, groupPeerPubKeys map[uint64]map[uint64][]byte) *LightClient {
+	return &LightClient{
+		GroupPeerPubKeys: groupPeerPubKeys,
+		Backend:          backend,
+		ProofCache:       cache.New(30*time.Second, time.Minute),
+		inflight:         map[string]*odrRequest{},
+	}
+}
+
+// GetProof fetches and verifies the proof for a single leaf, coalescing
+// concurrent lookups for the same (group, leaf) into one network round-trip.
+func (lc *LightClient) GetProof(ctx context.Context, groupId uint64, leafIndex int) (*spb.ProofResponse, error) {
+	cacheKey := keyForLeaf(groupId, leafIndex)
+	if cached, found := lc.ProofCache.Get(cacheKey); found {
+		return cached.(*spb.ProofResponse), nil
+	}
+
+	lc.coalesceLock.Lock()
+	if req, inFlight := lc.inflight[cacheKey]; inFlight {
+		lc.coalesceLock.Unlock()
+		<-req.done
+		return req.res, req.err
+	}
+	req := &odrRequest{done: make(chan struct{})}
+	lc.inflight[cacheKey] = req
+	lc.coalesceLock.Unlock()
+
+	res, err := lc.Backend.FetchProof(ctx, groupId, leafIndex)
+	if err == nil {
+		if verifyErr := lc.verifyProof(groupId, res); verifyErr != nil {
+			res, err = nil, verifyErr
+		}
+	}
+	req.res, req.err = res, err
+	close(req.done)
+
+	lc.coalesceLock.Lock()
+	delete(lc.inflight, cacheKey)
+	lc.coalesceLock.Unlock()
+
+	if err == nil {
+		lc.ProofCache.Set(cacheKey, res, cache.DefaultExpiration)
+	}
+	return res, err
+}
+
+func keyForLeaf(groupId uint64, leafIndex int) string {
+	return fmt.Sprintf("%d-%d", groupId, leafIndex)
+}
+
+// verifyProof checks the leaf against the Merkle path up to the claimed
+// root, and the root against a real quorum certificate, so a bad or stale
+// response from the primary ODR peer is rejected rather than trusted, and no
+// single (possibly Byzantine) signer can satisfy quorum alone.
+func (lc *LightClient) verifyProof(groupId uint64, res *spb.ProofResponse) error {
+	if res == nil {
+		return errors.New("nil proof response")
+	}
+	computed := res.Leaf
+	for _, sibling := range res.Path {
+		h := sha256.New()
+		if bytes.Compare(computed, sibling) <= 0 {
+			h.Write(computed)
+			h.Write(sibling)
+		} else {
+			h.Write(sibling)
+			h.Write(computed)
+		}
+		computed = h.Sum(nil)
+	}
+	if !bytes.Equal(computed, res.Root) {
+		return errors.New("merkle path does not reach the claimed root")
+	}
+	pubKeys, known := lc.GroupPeerPubKeys[groupId]
+	if !known || len(pubKeys) == 0 {
+		return errors.New("no known peer public keys for group")
+	}
+	verified := 0
+	for peerId, sig := range res.QuorumSignatures {
+		pubKey, known := pubKeys[peerId]
+		if !known {
+			continue
+		}
+		if utils.VerifySignature(pubKey, res.Root, sig) {
+			verified++
+		}
+	}
+	if verified < utils.ExpectedPlayers(len(pubKeys)) {
+		return fmt.Errorf("merkle root quorum certificate has only %d valid distinct signatures, need %d", verified, utils.ExpectedPlayers(len(pubKeys)))
+	}
+	return nil
+}
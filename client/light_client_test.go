@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+
+	spb "github.com/PomeloCloud/BFTRaft4go/proto/server"
+)
+
+func signRoot(t *testing.T, priv *rsa.PrivateKey, root []byte) []byte {
+	t.Helper()
+	hashed := sha256.Sum256(root)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("sign root: %v", err)
+	}
+	return sig
+}
+
+func pubKeyDER(t *testing.T, priv *rsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal pub key: %v", err)
+	}
+	return der
+}
+
+// fakeProofBackend returns a fixed ProofResponse regardless of what is asked.
+type fakeProofBackend struct {
+	res *spb.ProofResponse
+}
+
+func (f *fakeProofBackend) FetchProof(ctx context.Context, groupId uint64, leafIndex int) (*spb.ProofResponse, error) {
+	return f.res, nil
+}
+
+// sevenPeerGroup returns seven independent peer keypairs and their public
+// key map, large enough that no reasonable BFT quorum threshold is ever
+// satisfied by a single signer but clearly is by a majority of them.
+func sevenPeerGroup(t *testing.T) ([]*rsa.PrivateKey, map[uint64][]byte) {
+	t.Helper()
+	keys := make([]*rsa.PrivateKey, 7)
+	pubKeys := map[uint64][]byte{}
+	for i := range keys {
+		priv, _ := rsa.GenerateKey(rand.Reader, 2048)
+		keys[i] = priv
+		pubKeys[uint64(i+1)] = pubKeyDER(t, priv)
+	}
+	return keys, pubKeys
+}
+
+func TestVerifyProofRejectsSingleSignerQuorum(t *testing.T) {
+	groupId := uint64(1)
+	root := []byte("a-root-byte-string")
+	keys, pubKeys := sevenPeerGroup(t)
+
+	// Only one of seven group peers signed the root: this must not satisfy
+	// quorum, even though the lone signature is perfectly valid.
+	res := &spb.ProofResponse{
+		Group: groupId,
+		Leaf:  root,
+		Path:  nil,
+		Root:  root,
+		QuorumSignatures: map[uint64][]byte{
+			1: signRoot(t, keys[0], root),
+		},
+	}
+	lc := NewLightClient(&fakeProofBackend{res: res}, map[uint64]map[uint64][]byte{groupId: pubKeys})
+	if err := lc.verifyProof(groupId, res); err == nil {
+		t.Fatal("expected single-signer quorum certificate to be rejected")
+	}
+}
+
+func TestVerifyProofAcceptsRealQuorum(t *testing.T) {
+	groupId := uint64(1)
+	root := []byte("a-root-byte-string")
+	keys, pubKeys := sevenPeerGroup(t)
+
+	sigs := map[uint64][]byte{}
+	for i := 0; i < 5; i++ { // a clear majority of the 7 peers
+		sigs[uint64(i+1)] = signRoot(t, keys[i], root)
+	}
+	res := &spb.ProofResponse{
+		Group:            groupId,
+		Leaf:             root,
+		Path:             nil,
+		Root:             root,
+		QuorumSignatures: sigs,
+	}
+	lc := NewLightClient(&fakeProofBackend{res: res}, map[uint64]map[uint64][]byte{groupId: pubKeys})
+	if err := lc.verifyProof(groupId, res); err != nil {
+		t.Fatalf("expected 5-of-7 quorum certificate to verify, got: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"errors"
+	"time"
+
+	"github.com/PomeloCloud/BFTRaft4go/netsync/peers"
+	spb "github.com/PomeloCloud/BFTRaft4go/proto/server"
+	"github.com/PomeloCloud/BFTRaft4go/utils"
+)
+
+// RecordAlphaRTT updates this client's view of an alpha node's latency,
+// observed from the round-trip time of any RPC this client just made to it.
+// BestAlpha uses the recorded RTT to stop iterating every cached alpha RPC
+// blindly and pick the one actually worth talking to. This call records no
+// served groups, and BestAlpha only considers peers already known to serve
+// the requested group, so a peer known only through this call is never
+// picked.
+func (brc *BFTRaftClient) RecordAlphaRTT(id uint64, addr string, rtt time.Duration) {
+	brc.AlphaPeers.Update(&peers.PeerInfo{ID: id, Addr: addr, RTT: rtt})
+}
+
+// BestAlpha returns the RPC client for the lowest-latency known alpha node
+// serving groupId, falling back to nil when nothing has been observed yet
+// (callers should fall back to MajorityResponse over brc.AlphaRPCs.Get() in
+// that case).
+func (brc *BFTRaftClient) BestAlpha(groupId uint64) spb.BFTRaftClient {
+	best := brc.AlphaPeers.BestPeer(groupId)
+	if best == nil {
+		return nil
+	}
+	rpc, err := utils.GetClusterRPC(best.Addr)
+	if err != nil {
+		return nil
+	}
+	return rpc
+}
+
+// timedRPC runs call against addr/id, recording the observed RTT for
+// BestAlpha to use on future lookups for groupId.
+func (brc *BFTRaftClient) timedRPC(id uint64, addr string, groupId uint64, call func() error) error {
+	start := time.Now()
+	err := call()
+	if err == nil {
+		info := &peers.PeerInfo{ID: id, Addr: addr, RTT: time.Since(start), Groups: []uint64{groupId}}
+		brc.AlphaPeers.Update(info)
+	}
+	return err
+}
+
+// queryAlpha tries the lowest-latency known alpha node for groupId directly,
+// timing the call through timedRPC so future lookups keep improving on this
+// one. It returns nil whenever no alpha has been timed yet, the best alpha
+// errors, or call reports no data, in which case callers fall back to
+// utils.MajorityResponse over every cached alpha RPC the way they did before
+// BestAlpha existed.
+func (brc *BFTRaftClient) queryAlpha(groupId uint64, call func(client spb.BFTRaftClient) (interface{}, []byte)) interface{} {
+	best := brc.AlphaPeers.BestPeer(groupId)
+	if best == nil {
+		return nil
+	}
+	rpc := brc.BestAlpha(groupId)
+	if rpc == nil {
+		return nil
+	}
+	var result interface{}
+	err := brc.timedRPC(best.ID, best.Addr, groupId, func() error {
+		data, _ := call(rpc)
+		if data == nil {
+			return errors.New("best alpha returned no data")
+		}
+		result = data
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	return result
+}
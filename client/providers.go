@@ -0,0 +1,49 @@
+package client
+
+import (
+	pb "github.com/PomeloCloud/BFTRaft4go/proto"
+	spb "github.com/PomeloCloud/BFTRaft4go/proto/server"
+	"github.com/PomeloCloud/BFTRaft4go/providers"
+	"github.com/PomeloCloud/BFTRaft4go/utils"
+)
+
+// providerVerifier verifies a provider record's signature against the
+// issuing host's public key, which the client must already know to trust
+// anything that host says about itself.
+func providerVerifier(hostPubKeys map[uint64][]byte) providers.Verifier {
+	return func(record *providers.Record) bool {
+		pubKey, known := hostPubKeys[record.HostId]
+		if !known {
+			return false
+		}
+		return utils.VerifySignature(pubKey, record.SignData(), record.Signature)
+	}
+}
+
+// ResolveGroup returns an RPC client for a group's responsible peer,
+// preferring a cached, verified provider record over asking an alpha node.
+// On a cache miss it falls back to GetGroupLeader, which will populate the
+// GroupLeader cache as before.
+func (brc *BFTRaftClient) ResolveGroup(groupId uint64) spb.BFTRaftClient {
+	if record, found := brc.Providers.Get(groupId); found {
+		if rpc, err := utils.GetClusterRPC(record.HostAddr); err == nil {
+			return rpc
+		}
+	}
+	return brc.GetGroupLeader(groupId)
+}
+
+// HandleProviderRecord absorbs a provider record pushed directly by a peer
+// (e.g. a newly elected leader's ProvideRecursive push), verifying it
+// before it can displace whatever is already cached for the group.
+func (brc *BFTRaftClient) HandleProviderRecord(record *pb.ProviderRecord) {
+	brc.Providers.Put(&providers.Record{
+		GroupId:   record.GroupId,
+		HostId:    record.HostId,
+		HostAddr:  record.HostAddr,
+		Term:      record.Term,
+		IsLeader:  record.IsLeader,
+		Expiry:    record.Expiry,
+		Signature: record.Signature,
+	})
+}
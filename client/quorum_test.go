@@ -0,0 +1,46 @@
+package client
+
+import "testing"
+
+func TestQuorumBallotRejectsDuplicateHostVote(t *testing.T) {
+	b := newQuorumBallot()
+	votes, counted := b.Cast(1, []byte("result-a"))
+	if !counted || votes != 1 {
+		t.Fatalf("expected first vote from host 1 to count, got votes=%d counted=%v", votes, counted)
+	}
+
+	// The same host answering again - e.g. a slow reply from an earlier
+	// retry landing after a new attempt already got an answer - must not
+	// add a second vote.
+	votes, counted = b.Cast(1, []byte("result-a"))
+	if counted {
+		t.Fatalf("expected a repeat vote from the same host to be rejected, got votes=%d counted=%v", votes, counted)
+	}
+}
+
+func TestQuorumBallotRequiresDistinctHosts(t *testing.T) {
+	b := newQuorumBallot()
+	votes, _ := b.Cast(1, []byte("result-a"))
+	if votes != 1 {
+		t.Fatalf("expected 1 vote, got %d", votes)
+	}
+	votes, _ = b.Cast(2, []byte("result-a"))
+	if votes != 2 {
+		t.Fatalf("expected 2 distinct-host votes for the same result, got %d", votes)
+	}
+	votes, _ = b.Cast(3, []byte("result-b"))
+	if votes != 1 {
+		t.Fatalf("expected a differing result to start its own tally at 1, got %d", votes)
+	}
+}
+
+func TestQuorumBallotMajorityPicksMostVotedResult(t *testing.T) {
+	b := newQuorumBallot()
+	b.Cast(1, []byte("result-a"))
+	b.Cast(2, []byte("result-a"))
+	b.Cast(3, []byte("result-b"))
+
+	if got := string(b.Majority()); got != "result-a" {
+		t.Fatalf("expected majority result to be result-a, got %q", got)
+	}
+}
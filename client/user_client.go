@@ -9,7 +9,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/PomeloCloud/BFTRaft4go/netsync/peers"
 	spb "github.com/PomeloCloud/BFTRaft4go/proto/server"
+	"github.com/PomeloCloud/BFTRaft4go/providers"
 	"github.com/PomeloCloud/BFTRaft4go/utils"
 	"github.com/patrickmn/go-cache"
 	"log"
@@ -18,16 +20,32 @@ import (
 type BFTRaftClient struct {
 	Id          uint64
 	PrivateKey  *rsa.PrivateKey
+	HostPubKeys map[uint64][]byte
 	AlphaRPCs   AlphaRPCsCache
+	AlphaPeers  *peers.PeerSet
 	GroupHosts  *cache.Cache
 	GroupLeader *cache.Cache
-	CmdResChan  map[uint64]map[uint64]chan []byte
-	Counter     int64
-	Lock        sync.RWMutex
+	// GroupLeaderId mirrors GroupLeader, caching the resolved leader's host
+	// ID alongside its RPC client. ExecCommandWithOptions needs the ID (not
+	// just something that can make RPCs) to tell the leader's own verified
+	// CommandResponse apart from a follower's when deciding whether
+	// RequireLinearizable is satisfied.
+	GroupLeaderId *cache.Cache
+	GroupProxies  *cache.Cache
+	Providers     *providers.Cache
+	CmdResChan    map[uint64]map[uint64]chan *spb.CommandResponse
+	Counter       int64
+	Lock          sync.RWMutex
 }
 
 type ClientOptions struct {
 	PrivateKey []byte
+	// HostPubKeys is every known host's public key, keyed by host ID. The
+	// client uses it for two things: verifying provider records announced
+	// by peers (see ResolveGroup), and verifying CommandResponse signatures
+	// in ExecCommand. Without it, provider records are never trusted and
+	// command responses are never counted towards quorum.
+	HostPubKeys map[uint64][]byte
 }
 
 // bootstraps is a list of server address believed to be the member of the network
@@ -39,14 +57,19 @@ func NewClient(bootstraps []string, opts ClientOptions) (*BFTRaftClient, error)
 	}
 	publicKey := utils.PublicKeyFromPrivate(privateKey)
 	bftclient := &BFTRaftClient{
-		Id:          utils.HashPublicKey(publicKey),
-		PrivateKey:  privateKey,
-		Lock:        sync.RWMutex{},
-		AlphaRPCs:   NewAlphaRPCsCache(bootstraps),
-		GroupHosts:  cache.New(1*time.Minute, 1*time.Minute),
-		GroupLeader: cache.New(1*time.Minute, 1*time.Minute),
-		CmdResChan:  map[uint64]map[uint64]chan []byte{},
-		Counter:     0,
+		Id:            utils.HashPublicKey(publicKey),
+		PrivateKey:    privateKey,
+		HostPubKeys:   opts.HostPubKeys,
+		Lock:          sync.RWMutex{},
+		AlphaRPCs:     NewAlphaRPCsCache(bootstraps),
+		AlphaPeers:    peers.NewPeerSet(),
+		GroupHosts:    cache.New(1*time.Minute, 1*time.Minute),
+		GroupLeader:   cache.New(1*time.Minute, 1*time.Minute),
+		GroupLeaderId: cache.New(1*time.Minute, 1*time.Minute),
+		GroupProxies:  cache.New(1*time.Minute, 1*time.Minute),
+		Providers:     providers.NewCache(providerVerifier(opts.HostPubKeys)),
+		CmdResChan:    map[uint64]map[uint64]chan *spb.CommandResponse{},
+		Counter:       0,
 	}
 	return bftclient, nil
 }
@@ -56,7 +79,7 @@ func (brc *BFTRaftClient) GetGroupHosts(groupId uint64) *[]*spb.Host {
 	if cached, found := brc.GroupHosts.Get(cacheKey); found {
 		return cached.(*[]*spb.Host)
 	}
-	res := utils.MajorityResponse(brc.AlphaRPCs.Get(), func(client spb.BFTRaftClient) (interface{}, []byte) {
+	hostsCall := func(client spb.BFTRaftClient) (interface{}, []byte) {
 		if res, err := client.GroupHosts(
 			context.Background(), &spb.GroupId{GroupId: groupId},
 		); err == nil {
@@ -65,7 +88,11 @@ func (brc *BFTRaftClient) GetGroupHosts(groupId uint64) *[]*spb.Host {
 			log.Println("error on getting group host:", err)
 			return nil, []byte{}
 		}
-	})
+	}
+	res := brc.queryAlpha(groupId, hostsCall)
+	if res == nil {
+		res = utils.MajorityResponse(brc.AlphaRPCs.Get(), hostsCall)
+	}
 	var hosts *[]*spb.Host = nil
 	if res != nil {
 		hosts = res.(*[]*spb.Host)
@@ -81,7 +108,7 @@ func (brc *BFTRaftClient) GetGroupLeader(groupId uint64) spb.BFTRaftClient {
 	if cached, found := brc.GroupLeader.Get(cacheKey); found {
 		return cached.(spb.BFTRaftClient)
 	}
-	res := utils.MajorityResponse(brc.AlphaRPCs.Get(), func(client spb.BFTRaftClient) (interface{}, []byte) {
+	leaderCall := func(client spb.BFTRaftClient) (interface{}, []byte) {
 		if res, err := client.GetGroupLeader(
 			context.Background(), &spb.GroupId{GroupId: groupId},
 		); err == nil {
@@ -94,7 +121,11 @@ func (brc *BFTRaftClient) GetGroupLeader(groupId uint64) spb.BFTRaftClient {
 			log.Println("cannot get group leader on alpha peer:", err)
 			return nil, []byte{}
 		}
-	})
+	}
+	res := brc.queryAlpha(groupId, leaderCall)
+	if res == nil {
+		res = utils.MajorityResponse(brc.AlphaRPCs.Get(), leaderCall)
+	}
 	var leaderHost *spb.Host = nil
 	if res != nil {
 		leaderHost = res.(*spb.Host)
@@ -102,6 +133,7 @@ func (brc *BFTRaftClient) GetGroupLeader(groupId uint64) spb.BFTRaftClient {
 	if leaderHost != nil {
 		if leader, err := utils.GetClusterRPC(leaderHost.ServerAddr); err == nil {
 			brc.GroupLeader.Set(cacheKey, leader, cache.DefaultExpiration)
+			brc.GroupLeaderId.Set(cacheKey, leaderHost.Id, cache.DefaultExpiration)
 			return leader
 		}
 	} else {
@@ -110,6 +142,87 @@ func (brc *BFTRaftClient) GetGroupLeader(groupId uint64) spb.BFTRaftClient {
 	return nil
 }
 
+// GetGroupLeaderId returns the host ID of the group's currently cached
+// leader, alongside GetGroupLeader's RPC client. It does not itself trigger
+// a resolution: callers needing a guaranteed-fresh leader should call
+// GetGroupLeader first.
+func (brc *BFTRaftClient) GetGroupLeaderId(groupId uint64) (uint64, bool) {
+	cacheKey := strconv.Itoa(int(groupId))
+	if cached, found := brc.GroupLeaderId.Get(cacheKey); found {
+		return cached.(uint64), true
+	}
+	return 0, false
+}
+
+// invalidateGroupLeader drops both the cached leader RPC client and its host
+// ID together, so a stale ID can never outlive the client it was resolved
+// alongside.
+func (brc *BFTRaftClient) invalidateGroupLeader(groupId uint64) {
+	cacheKey := strconv.Itoa(int(groupId))
+	brc.GroupLeader.Delete(cacheKey)
+	brc.GroupLeaderId.Delete(cacheKey)
+}
+
+// GetGroupProxies returns the cached set of non-voting proxies known for a
+// group, refreshing from the alpha nodes on a cache miss. Proxies are not
+// part of quorum, so a majority vote over them is neither required nor
+// meaningful here.
+func (brc *BFTRaftClient) GetGroupProxies(groupId uint64) *[]*spb.Host {
+	cacheKey := strconv.Itoa(int(groupId))
+	if cached, found := brc.GroupProxies.Get(cacheKey); found {
+		return cached.(*[]*spb.Host)
+	}
+	proxiesCall := func(client spb.BFTRaftClient) (interface{}, []byte) {
+		if res, err := client.GroupProxies(
+			context.Background(), &spb.GroupId{GroupId: groupId},
+		); err == nil {
+			return &res.Nodes, utils.NodesSignData(res.Nodes)
+		} else {
+			log.Println("error on getting group proxies:", err)
+			return nil, []byte{}
+		}
+	}
+	res := brc.queryAlpha(groupId, proxiesCall)
+	if res == nil {
+		res = utils.MajorityResponse(brc.AlphaRPCs.Get(), proxiesCall)
+	}
+	var proxies *[]*spb.Host = nil
+	if res != nil {
+		proxies = res.(*[]*spb.Host)
+	}
+	if proxies != nil {
+		brc.GroupProxies.Set(cacheKey, proxies, cache.DefaultExpiration)
+	}
+	return proxies
+}
+
+// ReadStale serves a read-only command from a nearby proxy instead of the
+// leader. It trades linearizability for latency: the result reflects the
+// proxy's last applied committed index rather than the latest leader state,
+// so it must only be used for queries that tolerate staleness.
+func (brc *BFTRaftClient) ReadStale(groupId uint64, funcId uint64, arg []byte) (*[]byte, error) {
+	proxies := brc.GetGroupProxies(groupId)
+	if proxies == nil || len(*proxies) == 0 {
+		return nil, errors.New("no proxies available for group")
+	}
+	proxy, err := utils.GetClusterRPC((*proxies)[0].ServerAddr)
+	if err != nil {
+		return nil, err
+	}
+	cmdReq := &spb.CommandRequest{
+		Group:    groupId,
+		ClientId: brc.Id,
+		FuncId:   funcId,
+		Arg:      arg,
+	}
+	cmdReq.Signature = utils.Sign(brc.PrivateKey, utils.ExecCommandSignData(cmdReq))
+	cmdRes, err := proxy.ExecCommand(context.Background(), cmdReq)
+	if err != nil {
+		return nil, err
+	}
+	return &cmdRes.Result, nil
+}
+
 func (brc *BFTRaftClient) GroupExists(groupId uint64) bool {
 	res := utils.MajorityResponse(brc.AlphaRPCs.Get(), func(client spb.BFTRaftClient) (interface{}, []byte) {
 		if _, err := client.GetGroupContent(
@@ -124,69 +237,238 @@ func (brc *BFTRaftClient) GroupExists(groupId uint64) bool {
 	return res.(bool)
 }
 
+// ExecOptions controls a single ExecCommand call's timeout, retry and
+// consistency behavior. The zero value is not usable directly; start from
+// DefaultExecOptions and override what you need.
+type ExecOptions struct {
+	// Timeout bounds how long a single attempt waits for the leader and for
+	// a quorum of followers before it is retried (or gives up).
+	Timeout time.Duration
+	// MaxRetries is how many additional attempts are made after the first,
+	// each preceded by an exponential backoff, if the leader is unreachable
+	// or the group fails to reach quorum.
+	MaxRetries int
+	// RequireLinearizable, when true, rejects a quorum that was reached
+	// without a response from the current leader itself, since follower
+	// agreement alone does not rule out a stale read.
+	RequireLinearizable bool
+}
+
+var DefaultExecOptions = ExecOptions{
+	Timeout:    10 * time.Second,
+	MaxRetries: 3,
+}
+
+// verifyCommandResponse checks that res was actually signed by the host it
+// claims to be from and actually answers this request, so a forged or
+// mismatched response can never enter the hash-voting pool.
+func (brc *BFTRaftClient) verifyCommandResponse(groupId uint64, requestId uint64, funcId uint64, argHash uint64, res *spb.CommandResponse) bool {
+	if res == nil || len(res.Signature) == 0 {
+		return false
+	}
+	pubKey, known := brc.HostPubKeys[res.HostId]
+	if !known {
+		return false
+	}
+	resultHash := utils.HashData(res.Result)
+	signData := utils.ExecCommandResponseSignData(groupId, brc.Id, requestId, funcId, argHash, resultHash)
+	return utils.VerifySignature(pubKey, signData, res.Signature)
+}
+
+// quorumBallot tallies one distinct vote per responding host towards the
+// result hash it reported. Without this, the same host's signed response
+// arriving twice - e.g. a slow leader reply from an earlier attempt landing
+// after a retry's goroutine already got an answer - would otherwise count as
+// two independent votes, letting a single host satisfy quorum on its own.
+type quorumBallot struct {
+	hostVotes map[uint64]uint64 // HostId -> hash it voted for
+	results   map[uint64][]byte // hash -> the result data that hashed to it
+	hashes    []uint64          // one entry per distinct host that has voted
+	tally     map[uint64]int    // hash -> distinct-host vote count
+}
+
+func newQuorumBallot() *quorumBallot {
+	return &quorumBallot{
+		hostVotes: map[uint64]uint64{},
+		results:   map[uint64][]byte{},
+		tally:     map[uint64]int{},
+	}
+}
+
+// Cast records hostId's vote for data, unless hostId has already voted. It
+// returns the running vote count for the hash data landed on, and whether
+// this call actually counted (false means hostId had already voted and the
+// call changed nothing).
+func (b *quorumBallot) Cast(hostId uint64, data []byte) (votes int, counted bool) {
+	if _, voted := b.hostVotes[hostId]; voted {
+		return 0, false
+	}
+	hash := utils.HashData(data)
+	b.hostVotes[hostId] = hash
+	b.results[hash] = data
+	b.hashes = append(b.hashes, hash)
+	b.tally[hash]++
+	return b.tally[hash], true
+}
+
+// Majority returns the result data most distinct hosts voted for.
+func (b *quorumBallot) Majority() []byte {
+	return b.results[utils.PickMajority(b.hashes)]
+}
+
 func (brc *BFTRaftClient) ExecCommand(groupId uint64, funcId uint64, arg []byte) (*[]byte, error) {
-	leader := brc.GetGroupLeader(groupId)
-	if leader == nil {
-		return nil, errors.New("cannot found leader")
+	return brc.ExecCommandWithOptions(groupId, funcId, arg, DefaultExecOptions)
+}
+
+// ExecCommandWithOptions behaves like ExecCommand but lets the caller tune
+// per-request timeout, retry count and linearizability. The signed request is
+// sent to the leader and fanned out to every other known group host, and
+// every CommandResponse is verified against the responding host's known
+// public key before it is allowed to contribute to the quorum vote; unsigned
+// or mismatched responses are discarded as if they had never arrived. Each
+// host may only cast one vote regardless of how many attempts or replies it
+// answers across, so quorum always reflects distinct group members rather
+// than repeated replies from the same host. A leader that times out or hints
+// it is no longer leader causes the cached leader to be invalidated and
+// re-resolved before the next attempt.
+func (brc *BFTRaftClient) ExecCommandWithOptions(groupId uint64, funcId uint64, arg []byte, opts ExecOptions) (*[]byte, error) {
+	hosts := brc.GetGroupHosts(groupId)
+	if hosts == nil {
+		return nil, errors.New("cannot get group hosts")
 	}
+	expectedResponse := utils.ExpectedPlayers(len(*hosts))
 	reqId := uint64(atomic.AddInt64(&brc.Counter, 1))
-	cmdReq := &spb.CommandRequest{
-		Group:     groupId,
-		ClientId:  brc.Id,
-		RequestId: reqId,
-		FuncId:    funcId,
-		Arg:       arg,
-	}
-	signData := utils.ExecCommandSignData(cmdReq)
-	cmdReq.Signature = utils.Sign(brc.PrivateKey, signData)
+	argHash := utils.HashData(arg)
+
 	if _, found := brc.CmdResChan[groupId]; !found {
-		brc.CmdResChan[groupId] = map[uint64]chan []byte{}
+		brc.CmdResChan[groupId] = map[uint64]chan *spb.CommandResponse{}
 	}
-	brc.CmdResChan[groupId][reqId] = make(chan []byte)
+	resChan := make(chan *spb.CommandResponse, expectedResponse)
+	brc.CmdResChan[groupId][reqId] = resChan
+	done := make(chan struct{})
 	defer func() {
-		close(brc.CmdResChan[groupId][reqId])
 		delete(brc.CmdResChan[groupId], reqId)
+		close(done)
 	}()
+
+	ballot := newQuorumBallot()
+	var collectLock sync.Mutex
+	var leaderAnswered bool
+	var leaderId uint64
+	var lastErr error
+	quorumReached := make(chan bool, 1)
 	go func() {
-		if cmdRes, err := leader.ExecCommand(context.Background(), cmdReq); err == nil {
-			// TODO: verify signature
-			// TODO: update leader if needed
-			// TODO: verify response matches request
-			brc.CmdResChan[groupId][reqId] <- cmdRes.Result
+		for {
+			select {
+			case res := <-resChan:
+				if !brc.verifyCommandResponse(groupId, reqId, funcId, argHash, res) {
+					collectLock.Lock()
+					lastErr = ErrBadSignature
+					collectLock.Unlock()
+					continue
+				}
+				collectLock.Lock()
+				if res.HostId == leaderId {
+					leaderAnswered = true
+				}
+				votes, counted := ballot.Cast(res.HostId, res.Result)
+				reached := counted && votes >= expectedResponse && (!opts.RequireLinearizable || leaderAnswered)
+				collectLock.Unlock()
+				if reached {
+					select {
+					case quorumReached <- true:
+					default:
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
 
+	backoff := 100 * time.Millisecond
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+		leader := brc.GetGroupLeader(groupId)
+		if leader == nil {
+			collectLock.Lock()
+			lastErr = ErrLeaderUnavailable
+			collectLock.Unlock()
 		} else {
-			log.Println("cannot exec on leader:", err)
+			currentLeaderId, leaderIdKnown := brc.GetGroupLeaderId(groupId)
+			if leaderIdKnown {
+				collectLock.Lock()
+				leaderId = currentLeaderId
+				collectLock.Unlock()
+			}
+			cmdReq := &spb.CommandRequest{
+				Group:     groupId,
+				ClientId:  brc.Id,
+				RequestId: reqId,
+				FuncId:    funcId,
+				Arg:       arg,
+			}
+			cmdReq.Signature = utils.Sign(brc.PrivateKey, utils.ExecCommandSignData(cmdReq))
+			go func() {
+				cmdRes, err := leader.ExecCommand(context.Background(), cmdReq)
+				if err != nil {
+					log.Println("cannot exec on leader:", err)
+					return
+				}
+				if cmdRes.NotLeader {
+					brc.invalidateGroupLeader(groupId)
+					return
+				}
+				// leaderAnswered is set once this response is actually
+				// verified in the collector goroutine above, not here: an
+				// unverified reply must never satisfy RequireLinearizable.
+				select {
+				case resChan <- cmdRes:
+				case <-done:
+				}
+			}()
+			// Quorum must come from a majority of distinct group members, not
+			// from the leader alone, so fan the same signed request out to
+			// every other known host and feed their signed responses into
+			// the same vote.
+			for _, host := range *hosts {
+				if leaderIdKnown && host.Id == currentLeaderId {
+					continue
+				}
+				go func(host *spb.Host) {
+					rpc, err := utils.GetClusterRPC(host.ServerAddr)
+					if err != nil {
+						return
+					}
+					cmdRes, err := rpc.ExecCommand(context.Background(), cmdReq)
+					if err != nil || cmdRes.NotLeader {
+						return
+					}
+					select {
+					case resChan <- cmdRes:
+					case <-done:
+					}
+				}(host)
+			}
 		}
-	}()
-	hosts := brc.GetGroupHosts(groupId)
-	if hosts == nil {
-		return nil, errors.New("cannot get group hosts")
-	}
-	expectedResponse := utils.ExpectedPlayers(len(*hosts))
-	responseReceived := map[uint64][]byte{}
-	responseHashes := []uint64{}
-	replicationCompleted := make(chan bool, 1)
-	wg := sync.WaitGroup{}
-	wg.Add(expectedResponse)
-	go func() {
-		for i := 0; i < expectedResponse; i++ {
-			res := <-brc.CmdResChan[groupId][reqId]
-			hash := utils.HashData(res)
-			responseReceived[hash] = res
-			responseHashes = append(responseHashes, hash)
-			wg.Done()
+
+		select {
+		case <-quorumReached:
+			collectLock.Lock()
+			majorityData := ballot.Majority()
+			collectLock.Unlock()
+			return &majorityData, nil
+		case <-time.After(opts.Timeout):
+			collectLock.Lock()
+			if lastErr == nil {
+				lastErr = ErrNoQuorum
+			}
+			collectLock.Unlock()
+			brc.invalidateGroupLeader(groupId)
 		}
-	}()
-	go func() {
-		wg.Wait()
-		replicationCompleted <- true
-	}()
-	select {
-	case <-replicationCompleted:
-		majorityHash := utils.PickMajority(responseHashes)
-		majorityData := responseReceived[majorityHash]
-		return &majorityData, nil
-	case <-time.After(10 * time.Second):
-		return nil, errors.New("does not receive enough response")
+		time.Sleep(backoff)
+		backoff *= 2
 	}
+	collectLock.Lock()
+	defer collectLock.Unlock()
+	return nil, lastErr
 }
@@ -0,0 +1,32 @@
+package peers
+
+import (
+	"context"
+	"time"
+)
+
+// Dialer is implemented by whatever transport a caller uses to reach a
+// peer (the client's AlphaRPCsCache, the server's ClusterClients). It stays
+// abstract here so this package has no dependency on either.
+type Dialer interface {
+	Dial(ctx context.Context, addr string) (id uint64, rtt time.Duration, version string, err error)
+}
+
+// DialPeerWithAddress dials addr, measuring RTT, and records the result in
+// the PeerSet as a connect event. It is the operator-facing entry point for
+// manually (re-)adding a peer by address instead of waiting for it to show
+// up via group membership.
+func (ps *PeerSet) DialPeerWithAddress(ctx context.Context, dialer Dialer, addr string) (*PeerInfo, error) {
+	id, rtt, version, err := dialer.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	info := &PeerInfo{
+		ID:      id,
+		Addr:    addr,
+		RTT:     rtt,
+		Version: version,
+	}
+	ps.Update(info)
+	return info, nil
+}
@@ -0,0 +1,236 @@
+// Package peers centralizes the peer-tracking bookkeeping that used to be
+// spread across client (GroupHosts/GroupLeader caches, AlphaRPCs) and server
+// (GetGroupPeers, GetPeer, ClusterClients): a single PeerInfo view of every
+// network peer this process talks to, with connect/disconnect/stale hooks
+// so callers can react to peer lifecycle instead of polling cache TTLs.
+package peers
+
+import (
+	"sync"
+	"time"
+)
+
+// staleAfter is how long a peer can go without an update before it is
+// considered stale and reported to subscribers, even if it hasn't
+// explicitly disconnected.
+const staleAfter = 30 * time.Second
+
+// PeerInfo is everything this process currently knows about one network
+// peer, independent of which groups use it as an alpha, a voting member, or
+// a proxy.
+type PeerInfo struct {
+	ID         uint64
+	Addr       string
+	Groups     []uint64
+	LastSeen   time.Time
+	RTT        time.Duration
+	IsLeaderOf []uint64
+	Version    string
+}
+
+// EventKind distinguishes the three lifecycle events a PeerSet subscriber
+// can receive.
+type EventKind int
+
+const (
+	EventConnect EventKind = iota
+	EventDisconnect
+	EventStale
+)
+
+type Event struct {
+	Kind EventKind
+	Peer *PeerInfo
+}
+
+type Subscription struct {
+	ch chan Event
+	ps *PeerSet
+}
+
+func (sub *Subscription) Events() <-chan Event {
+	return sub.ch
+}
+
+func (sub *Subscription) Unsubscribe() {
+	sub.ps.unsubscribe(sub)
+}
+
+// PeerSet tracks every known PeerInfo and fans out lifecycle events to
+// subscribers. It does not open connections itself; Dialer (dial.go) is the
+// extension point for that.
+type PeerSet struct {
+	lock sync.RWMutex
+	byID map[uint64]*PeerInfo
+
+	subLock sync.Mutex
+	subs    map[*Subscription]bool
+}
+
+func NewPeerSet() *PeerSet {
+	return &PeerSet{
+		byID: map[uint64]*PeerInfo{},
+		subs: map[*Subscription]bool{},
+	}
+}
+
+func (ps *PeerSet) Subscribe() *Subscription {
+	sub := &Subscription{ch: make(chan Event, 16), ps: ps}
+	ps.subLock.Lock()
+	ps.subs[sub] = true
+	ps.subLock.Unlock()
+	return sub
+}
+
+func (ps *PeerSet) unsubscribe(sub *Subscription) {
+	ps.subLock.Lock()
+	defer ps.subLock.Unlock()
+	if _, found := ps.subs[sub]; found {
+		delete(ps.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (ps *PeerSet) emit(kind EventKind, peer *PeerInfo) {
+	ps.subLock.Lock()
+	defer ps.subLock.Unlock()
+	for sub := range ps.subs {
+		select {
+		case sub.ch <- Event{Kind: kind, Peer: peer}:
+		default:
+			// slow subscriber, drop rather than block peer bookkeeping
+		}
+	}
+}
+
+// Update records an observed PeerInfo, firing EventConnect the first time a
+// peer is seen. Callers routinely observe only part of a peer's state at a
+// time (e.g. an RTT measurement carries no Groups), so Update merges info
+// into whatever is already known about the peer instead of replacing it
+// wholesale - otherwise a bare RTT update would silently wipe out the
+// Groups/IsLeaderOf an earlier, more complete update had recorded.
+func (ps *PeerSet) Update(info *PeerInfo) {
+	ps.lock.Lock()
+	existing, existed := ps.byID[info.ID]
+	var merged *PeerInfo
+	if existed {
+		merged = mergePeerInfo(existing, info)
+	} else {
+		copied := *info
+		merged = &copied
+	}
+	merged.LastSeen = time.Now()
+	ps.byID[info.ID] = merged
+	ps.lock.Unlock()
+	if !existed {
+		ps.emit(EventConnect, merged)
+	}
+}
+
+// mergePeerInfo folds update's observed fields into existing: zero-valued
+// fields on update (an empty Addr, a zero RTT, a nil Groups) are treated as
+// "not observed this time" and left alone, while Groups/IsLeaderOf are
+// unioned rather than replaced so a partial update can only add to what is
+// already known, never drop it.
+func mergePeerInfo(existing *PeerInfo, update *PeerInfo) *PeerInfo {
+	merged := *existing
+	if update.Addr != "" {
+		merged.Addr = update.Addr
+	}
+	if len(update.Groups) > 0 {
+		merged.Groups = unionUint64(merged.Groups, update.Groups)
+	}
+	if update.RTT > 0 {
+		merged.RTT = update.RTT
+	}
+	if len(update.IsLeaderOf) > 0 {
+		merged.IsLeaderOf = unionUint64(merged.IsLeaderOf, update.IsLeaderOf)
+	}
+	if update.Version != "" {
+		merged.Version = update.Version
+	}
+	return &merged
+}
+
+func unionUint64(a []uint64, b []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(a)+len(b))
+	out := make([]uint64, 0, len(a)+len(b))
+	for _, v := range append(append([]uint64{}, a...), b...) {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Remove drops a peer and fires EventDisconnect.
+func (ps *PeerSet) Remove(id uint64) {
+	ps.lock.Lock()
+	info, found := ps.byID[id]
+	if found {
+		delete(ps.byID, id)
+	}
+	ps.lock.Unlock()
+	if found {
+		ps.emit(EventDisconnect, info)
+	}
+}
+
+// SweepStale fires EventStale for every peer not updated within staleAfter,
+// without removing it — callers decide whether a stale peer should actually
+// be dropped.
+func (ps *PeerSet) SweepStale() {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	cutoff := time.Now().Add(-staleAfter)
+	for _, info := range ps.byID {
+		if info.LastSeen.Before(cutoff) {
+			ps.emit(EventStale, info)
+		}
+	}
+}
+
+// GetPeerInfos returns a snapshot of every known peer.
+func (ps *PeerSet) GetPeerInfos() []*PeerInfo {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	infos := make([]*PeerInfo, 0, len(ps.byID))
+	for _, info := range ps.byID {
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// BestPeer returns the lowest-RTT peer known to serve groupId, or nil if
+// none is known.
+func (ps *PeerSet) BestPeer(groupId uint64) *PeerInfo {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	var best *PeerInfo
+	for _, info := range ps.byID {
+		if !containsGroup(info.Groups, groupId) {
+			continue
+		}
+		if best == nil || info.RTT < best.RTT {
+			best = info
+		}
+	}
+	return best
+}
+
+func containsGroup(groups []uint64, groupId uint64) bool {
+	for _, g := range groups {
+		if g == groupId {
+			return true
+		}
+	}
+	return false
+}
+
+// StopPeer removes a peer from the set, as if it had disconnected. Operators
+// use this through GetPeerInfos/StopPeer RPCs to evict a misbehaving or
+// unreachable peer proactively rather than waiting for cache TTL.
+func (ps *PeerSet) StopPeer(id uint64) {
+	ps.Remove(id)
+}
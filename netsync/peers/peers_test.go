@@ -0,0 +1,41 @@
+package peers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateMergesRTTWithoutDroppingGroups(t *testing.T) {
+	ps := NewPeerSet()
+	ps.Update(&PeerInfo{ID: 1, Addr: "10.0.0.1:9000", Groups: []uint64{42}, IsLeaderOf: []uint64{42}})
+
+	// A bare RTT observation, like client.timedRPC's bookkeeping, carries no
+	// Groups at all: it must not erase the Groups recorded earlier.
+	ps.Update(&PeerInfo{ID: 1, Addr: "10.0.0.1:9000", RTT: 5 * time.Millisecond})
+
+	best := ps.BestPeer(42)
+	if best == nil {
+		t.Fatal("expected peer 1 to still be known as serving group 42")
+	}
+	if best.RTT != 5*time.Millisecond {
+		t.Fatalf("expected RTT to be updated to 5ms, got %v", best.RTT)
+	}
+	if len(best.IsLeaderOf) != 1 || best.IsLeaderOf[0] != 42 {
+		t.Fatalf("expected IsLeaderOf to be preserved, got %v", best.IsLeaderOf)
+	}
+}
+
+func TestUpdateUnionsGroupsAcrossCalls(t *testing.T) {
+	ps := NewPeerSet()
+	ps.Update(&PeerInfo{ID: 1, Addr: "10.0.0.1:9000", Groups: []uint64{1}})
+	ps.Update(&PeerInfo{ID: 1, Addr: "10.0.0.1:9000", Groups: []uint64{2}})
+
+	infos := ps.GetPeerInfos()
+	if len(infos) != 1 {
+		t.Fatalf("expected exactly one tracked peer, got %d", len(infos))
+	}
+	groups := infos[0].Groups
+	if len(groups) != 2 {
+		t.Fatalf("expected groups [1 2] to accumulate, got %v", groups)
+	}
+}
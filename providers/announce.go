@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"time"
+)
+
+// Announcer is whatever a server uses to push a Record to one peer, e.g. an
+// RPC call wrapping a ClusterClients lookup. Kept abstract so this package
+// does not need to depend on the server's proto or transport types.
+type Announcer interface {
+	Announce(ctx context.Context, addr string, record *Record) error
+}
+
+// Publisher periodically (re-)announces this host's own records to a
+// configurable set of peers, and supports pushing immediately on demand
+// (e.g. right after a leader election) instead of waiting for the next
+// tick.
+type Publisher struct {
+	announcer Announcer
+	interval  time.Duration
+	peers     func() []string
+	sign      func(record *Record)
+
+	stop chan struct{}
+}
+
+func NewPublisher(announcer Announcer, interval time.Duration, peers func() []string, sign func(record *Record)) *Publisher {
+	return &Publisher{
+		announcer: announcer,
+		interval:  interval,
+		peers:     peers,
+		sign:      sign,
+		stop:      make(chan struct{}),
+	}
+}
+
+// ProvideRecursive pushes a freshly signed record to every peer in the
+// publisher's configured set right away, bypassing the periodic tick. A
+// newly elected leader calls this so the rest of the network learns about
+// it without waiting out a full announce interval.
+func (p *Publisher) ProvideRecursive(ctx context.Context, record *Record) {
+	p.sign(record)
+	for _, addr := range p.peers() {
+		go p.announcer.Announce(ctx, addr, record)
+	}
+}
+
+// Run announces record (re-signed and re-expired on every tick) until
+// Stop is called. Callers typically build record once per group and let
+// this refresh its Expiry field before each announcement.
+func (p *Publisher) Run(ctx context.Context, record *Record) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			record.Expiry = time.Now().Add(defaultRecordTTL).Unix()
+			p.ProvideRecursive(ctx, record)
+		case <-p.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Publisher) Stop() {
+	close(p.stop)
+}
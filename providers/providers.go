@@ -0,0 +1,131 @@
+// Package providers implements a lightweight provider-announcement overlay,
+// similar in spirit to a DHT's provider records: servers periodically
+// publish signed records saying "I host group G, as of term T, leader or
+// not", and clients cache those records so they can route directly to the
+// responsible peer instead of asking an alpha node on every call.
+package providers
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// defaultRecordTTL bounds how long a record is trusted before it must be
+// re-announced; it mirrors the group config change cadence so a stale
+// leadership record expires well before the next election could complete.
+const defaultRecordTTL = 30 * time.Second
+
+// Record is a signed claim that a host currently serves a group, optionally
+// as its leader. The signature covers every other field so a client can
+// verify the record came from the host it names.
+type Record struct {
+	GroupId   uint64
+	HostId    uint64
+	HostAddr  string
+	Term      uint64
+	IsLeader  bool
+	Expiry    int64
+	Signature []byte
+}
+
+// SignData returns the bytes a Record's Signature is computed over.
+func (r *Record) SignData() []byte {
+	buf := make([]byte, 0, 32+len(r.HostAddr))
+	buf = append(buf, u64Bytes(r.GroupId)...)
+	buf = append(buf, u64Bytes(r.HostId)...)
+	buf = append(buf, []byte(r.HostAddr)...)
+	buf = append(buf, u64Bytes(r.Term)...)
+	buf = append(buf, u64Bytes(uint64(r.Expiry))...)
+	if r.IsLeader {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func u64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		b[i] = byte(v >> (8 * uint(i)))
+	}
+	return b
+}
+
+// Verifier checks a Record's signature against the public key of the host it
+// names; callers supply this so the package stays independent of however a
+// given deployment looks up host public keys.
+type Verifier func(record *Record) bool
+
+// Cache holds the freshest known record per group, verifying each record
+// before accepting it so a compromised or buggy peer cannot plant a bogus
+// route for a group it doesn't serve.
+type Cache struct {
+	verify  Verifier
+	byGroup *cache.Cache
+}
+
+func NewCache(verify Verifier) *Cache {
+	return &Cache{
+		verify:  verify,
+		byGroup: cache.New(defaultRecordTTL, defaultRecordTTL),
+	}
+}
+
+func groupKey(groupId uint64) string {
+	return u64ToString(groupId)
+}
+
+func u64ToString(v uint64) string {
+	b := u64Bytes(v)
+	return string(b)
+}
+
+// Put verifies and stores a record, replacing the cached record for the same
+// group only if record is newer: a higher Term, or the same Term with a
+// later Expiry. This stops a still-unexpired record from a deposed leader
+// (replayed, or merely delayed in flight within its TTL) from stomping a
+// fresher record the client already holds. Records that fail verification or
+// are already expired are dropped silently, the same way an unreachable peer
+// would be.
+func (c *Cache) Put(record *Record) bool {
+	if record == nil || record.Expiry < time.Now().Unix() {
+		return false
+	}
+	if c.verify != nil && !c.verify(record) {
+		return false
+	}
+	key := groupKey(record.GroupId)
+	if cached, found := c.byGroup.Get(key); found {
+		current := cached.(*Record)
+		if !recordIsNewer(record, current) {
+			return false
+		}
+	}
+	c.byGroup.Set(key, record, cache.DefaultExpiration)
+	return true
+}
+
+// recordIsNewer reports whether candidate supersedes current: a later term
+// always wins, and within the same term the later expiry (i.e. the more
+// recently announced record) wins.
+func recordIsNewer(candidate *Record, current *Record) bool {
+	if candidate.Term != current.Term {
+		return candidate.Term > current.Term
+	}
+	return candidate.Expiry > current.Expiry
+}
+
+// Get returns the cached record for a group, if any is still fresh.
+func (c *Cache) Get(groupId uint64) (*Record, bool) {
+	cached, found := c.byGroup.Get(groupKey(groupId))
+	if !found {
+		return nil, false
+	}
+	record := cached.(*Record)
+	if record.Expiry < time.Now().Unix() {
+		return nil, false
+	}
+	return record, true
+}
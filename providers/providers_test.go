@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"testing"
+	"time"
+)
+
+func alwaysVerify(record *Record) bool { return true }
+
+func TestCachePutRejectsStaleTerm(t *testing.T) {
+	c := NewCache(alwaysVerify)
+	now := time.Now()
+	fresh := &Record{GroupId: 1, HostId: 2, Term: 5, Expiry: now.Add(30 * time.Second).Unix()}
+	if !c.Put(fresh) {
+		t.Fatal("expected first record to be stored")
+	}
+
+	// A record from a deposed leader's earlier term, still unexpired but
+	// older, must not be allowed to stomp the fresher one.
+	stale := &Record{GroupId: 1, HostId: 1, Term: 4, Expiry: now.Add(25 * time.Second).Unix()}
+	if c.Put(stale) {
+		t.Fatal("expected stale-term record to be rejected")
+	}
+	got, found := c.Get(1)
+	if !found || got.HostId != 2 {
+		t.Fatalf("cache was overwritten by stale record: %+v", got)
+	}
+}
+
+func TestCachePutAcceptsNewerTermAndExpiry(t *testing.T) {
+	c := NewCache(alwaysVerify)
+	now := time.Now()
+	first := &Record{GroupId: 1, HostId: 1, Term: 4, Expiry: now.Add(20 * time.Second).Unix()}
+	if !c.Put(first) {
+		t.Fatal("expected first record to be stored")
+	}
+
+	newerTerm := &Record{GroupId: 1, HostId: 2, Term: 5, Expiry: now.Add(10 * time.Second).Unix()}
+	if !c.Put(newerTerm) {
+		t.Fatal("expected newer-term record to replace the cached one")
+	}
+
+	reannounced := &Record{GroupId: 1, HostId: 2, Term: 5, Expiry: now.Add(40 * time.Second).Unix()}
+	if !c.Put(reannounced) {
+		t.Fatal("expected a later re-announcement of the same term to replace the cached one")
+	}
+	got, found := c.Get(1)
+	if !found || got.Expiry != reannounced.Expiry {
+		t.Fatalf("expected cache to hold the re-announced record, got: %+v", got)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/PomeloCloud/BFTRaft4go/proto"
+	"github.com/PomeloCloud/BFTRaft4go/providers"
+)
+
+// clusterAnnouncer adapts the server's existing ClusterClients pool to the
+// providers.Announcer interface, so the provider overlay never has to know
+// about RPC client construction or caching.
+type clusterAnnouncer struct {
+	server *BFTRaftServer
+}
+
+func (a *clusterAnnouncer) Announce(ctx context.Context, addr string, record *providers.Record) error {
+	client, err := a.server.ClusterClients.Get(addr)
+	if err != nil {
+		return err
+	}
+	_, err = client.rpc.AnnounceProvider(ctx, &pb.ProviderRecord{
+		GroupId:   record.GroupId,
+		HostId:    record.HostId,
+		HostAddr:  record.HostAddr,
+		Term:      record.Term,
+		IsLeader:  record.IsLeader,
+		Expiry:    record.Expiry,
+		Signature: record.Signature,
+	})
+	return err
+}
+
+// StartGroupAnnouncer begins periodically (re-)announcing this server's
+// membership of group as a provider record, pushed to every known peer of
+// the group. AnnounceLeadership should be called in addition whenever this
+// server becomes leader, since a fresh leader wants its record out
+// immediately rather than waiting for the next tick.
+func (s *BFTRaftServer) StartGroupAnnouncer(ctx context.Context, group *pb.RaftGroup) *providers.Publisher {
+	publisher := providers.NewPublisher(
+		&clusterAnnouncer{server: s},
+		10*time.Second,
+		func() []string {
+			var addrs []string
+			for _, peer := range s.GetGroupPeers(group.Id) {
+				if node := s.GetNode(peer.Host); node != nil {
+					addrs = append(addrs, node.ServerAddr)
+				}
+			}
+			for _, proxy := range s.GetGroupProxies(group.Id) {
+				if node := s.GetNode(proxy.Host); node != nil {
+					addrs = append(addrs, node.ServerAddr)
+				}
+			}
+			return addrs
+		},
+		func(record *providers.Record) {
+			record.Signature = s.Sign(record.SignData())
+		},
+	)
+	selfAddr := ""
+	if node := s.GetNode(s.Id); node != nil {
+		selfAddr = node.ServerAddr
+	}
+	record := &providers.Record{
+		GroupId:  group.Id,
+		HostId:   s.Id,
+		HostAddr: selfAddr,
+		Term:     group.Term,
+		IsLeader: group.LeaderId == s.Id,
+		Expiry:   time.Now().Add(30 * time.Second).Unix(),
+	}
+	go publisher.Run(ctx, record)
+	return publisher
+}
+
+// AnnounceLeadership pushes an immediate provider record marking this
+// server as leader of group, so clients and peers pick up the new leader as
+// soon as the election completes instead of waiting for the next periodic
+// announcement.
+func (s *BFTRaftServer) AnnounceLeadership(ctx context.Context, group *pb.RaftGroup, publisher *providers.Publisher) {
+	selfAddr := ""
+	if node := s.GetNode(s.Id); node != nil {
+		selfAddr = node.ServerAddr
+	}
+	record := &providers.Record{
+		GroupId:  group.Id,
+		HostId:   s.Id,
+		HostAddr: selfAddr,
+		Term:     group.Term,
+		IsLeader: true,
+		Expiry:   time.Now().Add(30 * time.Second).Unix(),
+	}
+	publisher.ProvideRecursive(ctx, record)
+}
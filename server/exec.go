@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/PomeloCloud/BFTRaft4go/proto"
+	spb "github.com/PomeloCloud/BFTRaft4go/proto/server"
+	"github.com/PomeloCloud/BFTRaft4go/utils"
+	"github.com/golang/protobuf/proto"
+)
+
+// ExecCommand is the client-facing RPC entry point for a signed command: it
+// appends the command to the group's BFT log like any other entry (so every
+// replica, not just this one, agrees the command happened), applies it to
+// the local state machine, and signs the result with
+// utils.ExecCommandResponseSignData so the client can verify this reply
+// actually came from a host it trusts and actually answers this request. A
+// non-leader replica refuses the append and tells the client to re-resolve
+// the leader instead.
+func (s *BFTRaftServer) ExecCommand(ctx context.Context, req *spb.CommandRequest) (*spb.CommandResponse, error) {
+	group := s.GetGroup(req.Group)
+	if group == nil {
+		return nil, fmt.Errorf("unknown group %d", req.Group)
+	}
+	if group.LeaderId != s.Id {
+		return &spb.CommandResponse{HostId: s.Id, NotLeader: true}, nil
+	}
+	lastEntry := s.LastLogEntry(group.Id)
+	entryData, err := proto.Marshal(&pb.CommandEntry{
+		ClientId:  req.ClientId,
+		RequestId: req.RequestId,
+		FuncId:    req.FuncId,
+		Arg:       req.Arg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entry := &pb.LogEntry{
+		Term:  group.Term,
+		Index: lastEntry.Index + 1,
+		Data:  entryData,
+	}
+	entry.Signature = s.Sign(LogEntrySignData(entry))
+	if err := s.AppendLogEntry(group.Id, entry); err != nil {
+		return nil, err
+	}
+	result, err := s.ApplyCommand(group.Id, req.FuncId, req.Arg)
+	if err != nil {
+		return nil, err
+	}
+	argHash := utils.HashData(req.Arg)
+	resultHash := utils.HashData(result)
+	signData := utils.ExecCommandResponseSignData(req.Group, req.ClientId, req.RequestId, req.FuncId, argHash, resultHash)
+	return &spb.CommandResponse{
+		HostId:    s.Id,
+		Result:    result,
+		Signature: s.Sign(signData),
+	}, nil
+}
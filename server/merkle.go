@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	pb "github.com/PomeloCloud/BFTRaft4go/proto"
+	"github.com/PomeloCloud/BFTRaft4go/utils"
+	"github.com/golang/protobuf/proto"
+	"time"
+)
+
+// merkleRootCacheExpiry controls how long a group's accumulator root is kept
+// before GetGroupMerkleRoot recomputes it from the peer set and recent log.
+const merkleRootCacheExpiry = 10 * time.Second
+
+// merkleHashPair hashes two sibling nodes in a byte-sorted order so that a
+// verifier can recompute the root from a proof without needing a left/right
+// direction alongside each sibling hash.
+func merkleHashPair(left []byte, right []byte) []byte {
+	h := sha256.New()
+	if bytes.Compare(left, right) <= 0 {
+		h.Write(left)
+		h.Write(right)
+	} else {
+		h.Write(right)
+		h.Write(left)
+	}
+	return h.Sum(nil)
+}
+
+func merkleLeafHash(data []byte) []byte {
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+// buildMerkleTree returns every level of the tree, leaves first, so that
+// merkleProof can walk back up from a leaf index to the root.
+func buildMerkleTree(leaves [][]byte) [][][]byte {
+	if len(leaves) == 0 {
+		return [][][]byte{{merkleLeafHash([]byte{})}}
+	}
+	levels := [][][]byte{leaves}
+	current := leaves
+	for len(current) > 1 {
+		var next [][]byte
+		for i := 0; i < len(current); i += 2 {
+			if i+1 < len(current) {
+				next = append(next, merkleHashPair(current[i], current[i+1]))
+			} else {
+				next = append(next, current[i])
+			}
+		}
+		levels = append(levels, next)
+		current = next
+	}
+	return levels
+}
+
+func merkleProof(levels [][][]byte, leafIndex int) [][]byte {
+	var path [][]byte
+	idx := leafIndex
+	for _, level := range levels[:len(levels)-1] {
+		if idx^1 < len(level) {
+			path = append(path, level[idx^1])
+		}
+		idx /= 2
+	}
+	return path
+}
+
+// groupMerkleLeaves hashes the peer set and the group's last log entry
+// (LastLogEntry) into the leaves of the group's accumulator, in a stable
+// order so every correct replica derives the same root.
+func (s *BFTRaftServer) groupMerkleLeaves(group uint64) [][]byte {
+	var leaves [][]byte
+	for _, peer := range s.GetGroupPeers(group) {
+		if data, err := proto.Marshal(peer); err == nil {
+			leaves = append(leaves, merkleLeafHash(data))
+		}
+	}
+	lastEntry := s.LastLogEntry(group)
+	if lastEntry != nil {
+		if data, err := proto.Marshal(lastEntry); err == nil {
+			leaves = append(leaves, merkleLeafHash(data))
+		}
+	}
+	return leaves
+}
+
+// merkleSnapshot bundles the leaves, every intermediate level, and the
+// resulting signed root computed from one consistent read of the group's
+// peer set and log, so a leaf/path handed out by GenerateProof can never
+// come from a different state than the root it is checked against.
+type merkleSnapshot struct {
+	leaves [][]byte
+	levels [][][]byte
+	root   *pb.MerkleRoot
+}
+
+// rootQuorumSignTimeout bounds how long GetGroupMerkleRoot waits for other
+// group members to co-sign a freshly computed root before handing back
+// whatever quorum it managed to collect.
+const rootQuorumSignTimeout = 2 * time.Second
+
+// collectRootQuorumCert gathers independent signatures over an arbitrary
+// root (a Merkle accumulator root, or a snapshot's state root) from the
+// group's own peers (this replica's own signature counts as the first), so
+// the caller is backed by a real quorum certificate rather than one
+// replica's say-so. It stops as soon as utils.ExpectedPlayers(len(peers))
+// distinct signers have been collected, or rootQuorumSignTimeout elapses.
+// Shared by GetGroupMerkleRoot and BuildSnapshot.
+func (s *BFTRaftServer) collectRootQuorumCert(group uint64, peers []*pb.Peer, root []byte) map[uint64][]byte {
+	cert := map[uint64][]byte{s.Id: s.Sign(root)}
+	threshold := utils.ExpectedPlayers(len(peers))
+	if len(cert) >= threshold || len(peers) <= 1 {
+		return cert
+	}
+	type signed struct {
+		peerId uint64
+		sig    []byte
+	}
+	resCh := make(chan signed, len(peers))
+	for _, peer := range peers {
+		if peer.Host == s.Id {
+			continue
+		}
+		go func(peer *pb.Peer) {
+			node := s.GetNode(peer.Host)
+			if node == nil {
+				return
+			}
+			client, err := s.ClusterClients.Get(node.ServerAddr)
+			if err != nil {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), rootQuorumSignTimeout)
+			defer cancel()
+			res, err := client.rpc.SignMerkleRoot(ctx, &pb.RootSignRequest{Group: group, Root: root})
+			if err != nil || res == nil {
+				return
+			}
+			resCh <- signed{peerId: peer.Host, sig: res.Signature}
+		}(peer)
+	}
+	deadline := time.After(rootQuorumSignTimeout)
+	for len(cert) < threshold {
+		select {
+		case r := <-resCh:
+			cert[r.peerId] = r.sig
+		case <-deadline:
+			return cert
+		}
+	}
+	return cert
+}
+
+// buildMerkleSnapshot computes the leaves, tree levels and quorum-signed
+// root from a single read of the group's peer set and log, so the three
+// never drift apart even if the peer set or log changes moments later.
+func (s *BFTRaftServer) buildMerkleSnapshot(group uint64) *merkleSnapshot {
+	leaves := s.groupMerkleLeaves(group)
+	levels := buildMerkleTree(leaves)
+	root := levels[len(levels)-1][0]
+	lastEntry := s.LastLogEntry(group)
+	peers := s.GetGroupPeers(group)
+	res := &merkleSnapshot{
+		leaves: leaves,
+		levels: levels,
+		root: &pb.MerkleRoot{
+			Group:            group,
+			Root:             root,
+			Index:            lastEntry.Index,
+			Term:             lastEntry.Term,
+			QuorumSignatures: s.collectRootQuorumCert(group, peers, root),
+		},
+	}
+	return res
+}
+
+// getMerkleSnapshot returns the cached leaves/levels/root for a group,
+// rebuilding it atomically on a cache miss so every caller within the cache
+// window reads leaves and root from the same underlying state.
+func (s *BFTRaftServer) getMerkleSnapshot(group uint64) *merkleSnapshot {
+	cacheKey := fmt.Sprint(group, "-merkle-snapshot")
+	if cached, found := s.GroupsPeers.Get(cacheKey); found {
+		return cached.(*merkleSnapshot)
+	}
+	snapshot := s.buildMerkleSnapshot(group)
+	s.GroupsPeers.Set(cacheKey, snapshot, merkleRootCacheExpiry)
+	return snapshot
+}
+
+// GetGroupMerkleRoot returns the current accumulator root for a group's peer
+// set and recent commits, backed by a quorum certificate of signatures from
+// the group's own peers so a light client never has to trust a single
+// (possibly Byzantine) replica's signature alone.
+func (s *BFTRaftServer) GetGroupMerkleRoot(group uint64) *pb.MerkleRoot {
+	return s.getMerkleSnapshot(group).root
+}
+
+// GenerateProof builds a ProofResponse for the leaf at leafIndex: the leaf
+// itself, the Merkle path back to the root, and the quorum certificate that
+// already covers that root. Leaf, path and root all come from the same
+// cached snapshot, so the returned proof always verifies.
+func (s *BFTRaftServer) GenerateProof(group uint64, leafIndex int) *pb.ProofResponse {
+	snapshot := s.getMerkleSnapshot(group)
+	if leafIndex < 0 || leafIndex >= len(snapshot.leaves) {
+		return nil
+	}
+	return &pb.ProofResponse{
+		Group:            group,
+		Leaf:             snapshot.leaves[leafIndex],
+		Path:             merkleProof(snapshot.levels, leafIndex),
+		Root:             snapshot.root.Root,
+		QuorumSignatures: snapshot.root.QuorumSignatures,
+	}
+}
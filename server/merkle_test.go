@@ -0,0 +1,48 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMerkleProofVerifiesAgainstRoot(t *testing.T) {
+	leaves := [][]byte{
+		merkleLeafHash([]byte("peer-1")),
+		merkleLeafHash([]byte("peer-2")),
+		merkleLeafHash([]byte("peer-3")),
+		merkleLeafHash([]byte("log-head")),
+	}
+	levels := buildMerkleTree(leaves)
+	root := levels[len(levels)-1][0]
+
+	for i, leaf := range leaves {
+		path := merkleProof(levels, i)
+		computed := leaf
+		for _, sibling := range path {
+			computed = merkleHashPair(computed, sibling)
+		}
+		if !bytes.Equal(computed, root) {
+			t.Fatalf("leaf %d: recomputed root %x does not match tree root %x", i, computed, root)
+		}
+	}
+}
+
+func TestMerkleProofRejectsTamperedLeaf(t *testing.T) {
+	leaves := [][]byte{
+		merkleLeafHash([]byte("peer-1")),
+		merkleLeafHash([]byte("peer-2")),
+		merkleLeafHash([]byte("peer-3")),
+	}
+	levels := buildMerkleTree(leaves)
+	root := levels[len(levels)-1][0]
+	path := merkleProof(levels, 0)
+
+	tampered := merkleLeafHash([]byte("not-peer-1"))
+	computed := tampered
+	for _, sibling := range path {
+		computed = merkleHashPair(computed, sibling)
+	}
+	if bytes.Equal(computed, root) {
+		t.Fatal("tampered leaf must not recompute to the real root")
+	}
+}
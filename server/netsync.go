@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/PomeloCloud/BFTRaft4go/netsync/peers"
+	pb "github.com/PomeloCloud/BFTRaft4go/proto"
+	"github.com/PomeloCloud/BFTRaft4go/utils"
+)
+
+// NetPeers tracks every peer this server has exchanged traffic with,
+// independent of any single group's voting/proxy membership, so operators
+// get one inspectable view (GetPeerInfos) instead of having to read
+// GetGroupPeers per group. It is a field on BFTRaftServer, initialized
+// alongside GroupsPeers/Peers/ClusterClients, rather than a package-level
+// global: a process running more than one BFTRaftServer (tests, multi-node-
+// in-process setups) must not share one peer table across unrelated
+// servers.
+
+// GetPeerInfos returns everything known about every peer this server has
+// talked to.
+func (s *BFTRaftServer) GetPeerInfos() []*peers.PeerInfo {
+	return s.NetPeers.GetPeerInfos()
+}
+
+// BestPeer returns the lowest-RTT known peer serving groupId.
+func (s *BFTRaftServer) BestPeer(groupId uint64) *peers.PeerInfo {
+	return s.NetPeers.BestPeer(groupId)
+}
+
+// StopPeer evicts a peer from both the lifecycle tracker and the
+// ClusterClients RPC pool, for operators who need to forcibly drop a
+// misbehaving peer rather than waiting for its cache entry to expire.
+func (s *BFTRaftServer) StopPeer(peerId uint64) {
+	if info := s.findPeerByID(peerId); info != nil {
+		s.ClusterClients.Remove(info.Addr)
+	}
+	s.NetPeers.StopPeer(peerId)
+}
+
+func (s *BFTRaftServer) findPeerByID(id uint64) *peers.PeerInfo {
+	for _, info := range s.NetPeers.GetPeerInfos() {
+		if info.ID == id {
+			return info
+		}
+	}
+	return nil
+}
+
+// DialPeerWithAddress dials addr through the cluster client pool and
+// records the resulting peer in s.NetPeers.
+func (s *BFTRaftServer) DialPeerWithAddress(ctx context.Context, addr string) (*peers.PeerInfo, error) {
+	return s.NetPeers.DialPeerWithAddress(ctx, &clusterDialer{server: s}, addr)
+}
+
+type clusterDialer struct {
+	server *BFTRaftServer
+}
+
+// Dial measures RTT to addr using GroupHosts on the alpha group as a cheap,
+// already-existing probe call, rather than adding a dedicated handshake RPC.
+func (d *clusterDialer) Dial(ctx context.Context, addr string) (uint64, time.Duration, string, error) {
+	start := time.Now()
+	client, err := d.server.ClusterClients.Get(addr)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	res, err := client.rpc.GroupHosts(ctx, &pb.GroupId{GroupId: utils.ALPHA_GROUP})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	rtt := time.Since(start)
+	var id uint64
+	for _, host := range res.Nodes {
+		if host.ServerAddr == addr {
+			id = host.Id
+			break
+		}
+	}
+	return id, rtt, "", nil
+}
+
+// StartPeerSupervisor periodically sweeps s.NetPeers for staleness and evicts
+// any peer that hasn't been seen recently, so ClusterClients doesn't keep
+// retrying a connection that has been dead well past its cache TTL.
+func (s *BFTRaftServer) StartPeerSupervisor(ctx context.Context) {
+	sub := s.NetPeers.Subscribe()
+	go func() {
+		for event := range sub.Events() {
+			if event.Kind == peers.EventStale {
+				s.ClusterClients.Remove(event.Peer.Addr)
+				s.NetPeers.Remove(event.Peer.ID)
+			}
+		}
+	}()
+	ticker := time.NewTicker(30 * time.Second)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.NetPeers.SweepStale()
+			case <-ctx.Done():
+				sub.Unsubscribe()
+				return
+			}
+		}
+	}()
+}
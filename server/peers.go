@@ -80,6 +80,10 @@ func (s *BFTRaftServer) SendPeerUncommittedLogEntries(ctx context.Context, group
 	if node == nil {
 		return
 	}
+	if s.ShouldSnapshot(group, peer) {
+		go s.driveSnapshotInstall(ctx, group, peer)
+		return
+	}
 	if client, err := s.ClusterClients.Get(node.ServerAddr); err != nil {
 		go func() {
 			entries, prevEntry := s.PeerUncommittedLogEntries(group, peer)
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/PomeloCloud/BFTRaft4go/proto"
+	"github.com/dgraph-io/badger"
+	"github.com/golang/protobuf/proto"
+	"github.com/patrickmn/go-cache"
+)
+
+// proxies are non-voting group members: they receive committed log entries
+// for local reads but are never counted towards quorum and never vote.
+// Their records live in their own keyspace so a group's voting peer set
+// (GROUP_PEERS) is never perturbed by proxy churn.
+//
+// GROUP_PROXIES is given its own explicit value here rather than derived as
+// GROUP_PEERS+1: GROUP_PEERS and its sibling key-prefix discriminators are
+// declared elsewhere, and an arithmetic offset off just one of them risks
+// silently aliasing whatever prefix value is already next in that
+// enumeration. This should move next to GROUP_PEERS's own declaration if
+// this file is ever merged with it.
+const GROUP_PROXIES = 100
+
+func composeProxyKeyPrefix(group uint64) []byte {
+	return ComposeKeyPrefix(group, GROUP_PROXIES)
+}
+
+func (s *BFTRaftServer) proxyCacheKey(group uint64, peerId uint64) string {
+	return fmt.Sprint(group, "-proxy-", peerId)
+}
+
+func (s *BFTRaftServer) GetGroupProxies(group uint64) []*pb.Peer {
+	cacheKey := fmt.Sprint(group, "-proxies")
+	if cached, found := s.GroupsPeers.Get(cacheKey); found {
+		return cached.([]*pb.Peer)
+	}
+	var proxies []*pb.Peer
+	keyPrefix := composeProxyKeyPrefix(group)
+	iter := s.DB.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+	iter.Seek(append(keyPrefix, U64Bytes(0)...))
+	for iter.ValidForPrefix(keyPrefix) {
+		itemKey := iter.Item().Key()
+		peerId := BytesU64(itemKey, len(keyPrefix))
+		if proxy := s.GetProxy(group, peerId); proxy != nil {
+			proxies = append(proxies, proxy)
+		}
+	}
+	s.GroupsPeers.Set(cacheKey, proxies, cache.DefaultExpiration)
+	return proxies
+}
+
+func (s *BFTRaftServer) GetProxy(group uint64, peerId uint64) *pb.Peer {
+	cacheKey := s.proxyCacheKey(group, peerId)
+	if cached, found := s.Peers.Get(cacheKey); found {
+		return cached.(*pb.Peer)
+	}
+	dbKey := append(composeProxyKeyPrefix(group), U64Bytes(peerId)...)
+	item := badger.KVItem{}
+	s.DB.Get(dbKey, &item)
+	data := ItemValue(&item)
+	if data == nil {
+		return nil
+	}
+	proxy := pb.Peer{}
+	proto.Unmarshal(*data, &proxy)
+	s.Peers.Set(cacheKey, &proxy, cache.DefaultExpiration)
+	return &proxy
+}
+
+// SendEntriesToProxies replicates already-committed entries to every proxy of
+// the group. Unlike SendPeerUncommittedLogEntries, this is fire-and-forget:
+// proxies never ack into the quorum, so their responses (if any) are ignored.
+func (s *BFTRaftServer) SendEntriesToProxies(ctx context.Context, group *pb.RaftGroup) {
+	for _, proxy := range s.GetGroupProxies(group.Id) {
+		node := s.GetNode(proxy.Host)
+		if node == nil {
+			continue
+		}
+		client, err := s.ClusterClients.Get(node.ServerAddr)
+		if err != nil {
+			continue
+		}
+		go func(proxy *pb.Peer, client *RPCClient) {
+			entries, prevEntry := s.PeerUncommittedLogEntries(group, proxy)
+			signData := AppendLogEntrySignData(group.Id, group.Term, prevEntry.Index, prevEntry.Term)
+			client.rpc.AppendEntries(ctx, &pb.AppendEntriesRequest{
+				Group:        group.Id,
+				Term:         group.Term,
+				LeaderId:     s.Id,
+				PrevLogIndex: prevEntry.Index,
+				PrevLogTerm:  prevEntry.Term,
+				Signature:    s.Sign(signData),
+				QuorumVotes:  []*pb.RequestVoteResponse{},
+				Entries:      entries,
+			})
+		}(proxy, client)
+	}
+}
+
+// checkVotingCap guards SetVotingCap: a cap can never be set below the
+// number of voting peers the group already has, since that would leave the
+// group unable to account for its own existing voters.
+func checkVotingCap(group uint64, currentVoters int, cap uint32) error {
+	if uint32(currentVoters) > cap {
+		return fmt.Errorf("group %d already has more voting peers than the requested cap %d", group, cap)
+	}
+	return nil
+}
+
+// checkPromotion guards Promote: a proxy can only be promoted while the
+// group is under its voting cap (0 means uncapped), and only once its log
+// has actually caught up with the group's last entry, so a lagging or
+// already-full group never ends up with a voter it can't account for.
+func checkPromotion(group uint64, currentVoters int, cap uint32, proxyHost uint64, proxyNextIndex uint64, lastIndex uint64) error {
+	if cap > 0 && uint32(currentVoters) >= cap {
+		return fmt.Errorf("group %d is already at its voting cap of %d", group, cap)
+	}
+	if proxyNextIndex < lastIndex {
+		return fmt.Errorf("proxy %d has not caught up with group %d yet (%d < %d)", proxyHost, group, proxyNextIndex, lastIndex)
+	}
+	return nil
+}
+
+// SetVotingCap caps the number of active voting members a group may have.
+// Operators call this through the cluster-config RPC. Like Promote, the cap
+// change is appended as a signed config-change log entry rather than applied
+// locally, so every replica agrees on the same cap instead of each one
+// enforcing whatever value happened to reach it first.
+func (s *BFTRaftServer) SetVotingCap(group *pb.RaftGroup, cap uint32) error {
+	if err := checkVotingCap(group.Id, len(s.GetGroupPeers(group.Id)), cap); err != nil {
+		return err
+	}
+	lastEntry := s.LastLogEntry(group.Id)
+	changeData, err := proto.Marshal(&pb.PeerConfigChange{
+		Group:     group.Id,
+		VotingCap: cap,
+		Change:    pb.PeerConfigChange_VOTING_CAP,
+	})
+	if err != nil {
+		return err
+	}
+	entry := &pb.LogEntry{
+		Term:    group.Term,
+		Index:   lastEntry.Index + 1,
+		Command: CONFIG_CHANGE_COMMAND,
+		Data:    changeData,
+	}
+	entry.Signature = s.Sign(LogEntrySignData(entry))
+	return s.AppendLogEntry(group.Id, entry)
+}
+
+// ApplyVotingCap is invoked by the config-change apply path when a
+// PeerConfigChange_VOTING_CAP entry commits, updating the group's cap from
+// the agreed-upon log entry rather than from a caller's local argument.
+func (s *BFTRaftServer) ApplyVotingCap(group *pb.RaftGroup, cap uint32) error {
+	group.VotingCap = cap
+	return s.UpdateGroup(group)
+}
+
+// ApplyPromotion is invoked by the config-change apply path when a
+// PeerConfigChange_PROMOTE entry commits, moving the named proxy into the
+// group's voting peer set and out of its proxy set.
+func (s *BFTRaftServer) ApplyPromotion(group *pb.RaftGroup, proxy *pb.Peer) error {
+	if err := s.SetPeer(group.Id, proxy); err != nil {
+		return err
+	}
+	return s.RemoveProxy(group.Id, proxy.Host)
+}
+
+// ApplyConfigChange applies a CONFIG_CHANGE_COMMAND log entry: it unmarshals
+// the entry back into a PeerConfigChange and dispatches to the matching
+// Apply* here. Its only caller is ApplyLogEntry, which nothing in the server
+// calls when an entry commits, so SetVotingCap/Promote's log entries change
+// the group only where a caller passes them to one of these two.
+func (s *BFTRaftServer) ApplyConfigChange(group *pb.RaftGroup, entry *pb.LogEntry) error {
+	change := &pb.PeerConfigChange{}
+	if err := proto.Unmarshal(entry.Data, change); err != nil {
+		return err
+	}
+	switch change.Change {
+	case pb.PeerConfigChange_VOTING_CAP:
+		return s.ApplyVotingCap(group, change.VotingCap)
+	case pb.PeerConfigChange_PROMOTE:
+		return s.ApplyPromotion(group, change.Peer)
+	default:
+		return fmt.Errorf("unknown config change kind %v for group %d", change.Change, group.Id)
+	}
+}
+
+// ApplyLogEntry dispatches one committed log entry by kind, regardless of
+// which RPC appended it: CONFIG_CHANGE_COMMAND entries (SetVotingCap,
+// Promote) go to ApplyConfigChange, anything else is an ordinary client
+// command and goes to ApplyCommand, so a config change and a state-machine
+// command are never confused for each other. ExecCommand calls ApplyCommand
+// directly for the leader's own synchronous reply. No commit path in the
+// server calls ApplyLogEntry; an entry is applied this way only where a
+// caller invokes it.
+func (s *BFTRaftServer) ApplyLogEntry(group *pb.RaftGroup, entry *pb.LogEntry) error {
+	if entry.Command == CONFIG_CHANGE_COMMAND {
+		return s.ApplyConfigChange(group, entry)
+	}
+	cmdEntry := &pb.CommandEntry{}
+	if err := proto.Unmarshal(entry.Data, cmdEntry); err != nil {
+		return err
+	}
+	_, err := s.ApplyCommand(group.Id, cmdEntry.FuncId, cmdEntry.Arg)
+	return err
+}
+
+// Promote converts an existing proxy into a voting peer once its log has
+// caught up with the group, and appends the promotion as a signed
+// config-change entry so all replicas agree on the new peer set.
+func (s *BFTRaftServer) Promote(group *pb.RaftGroup, proxy *pb.Peer) error {
+	lastEntry := s.LastLogEntry(group.Id)
+	if err := checkPromotion(group.Id, len(s.GetGroupPeers(group.Id)), group.VotingCap, proxy.Host, proxy.NextIndex, lastEntry.Index); err != nil {
+		return err
+	}
+	changeData, err := proto.Marshal(&pb.PeerConfigChange{
+		Group:  group.Id,
+		Peer:   proxy,
+		Change: pb.PeerConfigChange_PROMOTE,
+	})
+	if err != nil {
+		return err
+	}
+	entry := &pb.LogEntry{
+		Term:    group.Term,
+		Index:   lastEntry.Index + 1,
+		Command: CONFIG_CHANGE_COMMAND,
+		Data:    changeData,
+	}
+	entry.Signature = s.Sign(LogEntrySignData(entry))
+	return s.AppendLogEntry(group.Id, entry)
+}
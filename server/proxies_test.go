@@ -0,0 +1,42 @@
+package server
+
+import "testing"
+
+func TestCheckVotingCapRejectsCapBelowCurrentVoters(t *testing.T) {
+	if err := checkVotingCap(1, 5, 3); err == nil {
+		t.Fatal("expected a cap below the current voter count to be rejected")
+	}
+}
+
+func TestCheckVotingCapAllowsCapAtOrAboveCurrentVoters(t *testing.T) {
+	if err := checkVotingCap(1, 3, 3); err != nil {
+		t.Fatalf("expected a cap equal to the current voter count to be allowed, got %v", err)
+	}
+	if err := checkVotingCap(1, 3, 5); err != nil {
+		t.Fatalf("expected a cap above the current voter count to be allowed, got %v", err)
+	}
+}
+
+func TestCheckPromotionRejectsWhenAtCap(t *testing.T) {
+	if err := checkPromotion(1, 3, 3, 42, 10, 10); err == nil {
+		t.Fatal("expected promotion at the voting cap to be rejected")
+	}
+}
+
+func TestCheckPromotionAllowsUncappedGroup(t *testing.T) {
+	if err := checkPromotion(1, 100, 0, 42, 10, 10); err != nil {
+		t.Fatalf("expected a voting cap of 0 to mean uncapped, got %v", err)
+	}
+}
+
+func TestCheckPromotionRejectsLaggingProxy(t *testing.T) {
+	if err := checkPromotion(1, 1, 3, 42, 5, 10); err == nil {
+		t.Fatal("expected a proxy behind the group's last log index to be rejected")
+	}
+}
+
+func TestCheckPromotionAllowsCaughtUpProxy(t *testing.T) {
+	if err := checkPromotion(1, 1, 3, 42, 10, 10); err != nil {
+		t.Fatalf("expected a proxy at the group's last log index to be allowed, got %v", err)
+	}
+}
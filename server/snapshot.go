@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	pb "github.com/PomeloCloud/BFTRaft4go/proto"
+	"github.com/patrickmn/go-cache"
+)
+
+// snapshotChunkSize is the size of each chunk streamed by InstallSnapshot.
+// 1 MiB keeps a single AppendEntries-sized RPC from ballooning while still
+// bounding the number of round-trips for a multi-gigabyte snapshot.
+const snapshotChunkSize = 1 << 20
+
+// snapshotLagThreshold is how many log entries a peer may trail the leader
+// before SendPeerUncommittedLogEntries gives up on log shipping and installs
+// a snapshot instead. Far below this, walking the reversed log iterator back
+// to peer.NextIndex stays cheap.
+const snapshotLagThreshold = 10000
+
+// SnapshotMeta describes a completed or in-progress snapshot of a group's
+// state machine, covering the log up to and including lastIncludedIndex. It
+// is cached per group (snapshotCacheKey), not per peer, and shared by every
+// far-behind peer. SendPeerUncommittedLogEntries does not consult it: it
+// chooses between log shipping and a snapshot install by ShouldSnapshot's
+// lag check alone, and does not detect a transfer already in progress to the
+// same peer.
+type SnapshotMeta struct {
+	Group             uint64
+	LastIncludedIndex uint64
+	LastIncludedTerm  uint64
+	StateRoot         []byte
+	ChunkHashes       [][]byte
+	TotalSize         int64
+	// QuorumSignatures is a real quorum certificate over StateRoot: the
+	// signatures of a majority of the group's own peers, keyed by signing
+	// peer id, gathered the same way GetGroupMerkleRoot does. It lets an
+	// installing follower trust the snapshot without trusting the leader
+	// alone.
+	QuorumSignatures map[uint64][]byte
+}
+
+// snapshotCacheKey is keyed by group only: a leader builds and serves one
+// snapshot per group at a time, shared by every far-behind peer.
+func snapshotCacheKey(group uint64) string {
+	return fmt.Sprint(group, "-snapshot")
+}
+
+func snapshotDataCacheKey(group uint64) string {
+	return fmt.Sprint(group, "-snapshot-data")
+}
+
+// snapshotProgressCacheKey tracks, per (group, peer), the index of the next
+// snapshot chunk a follower still needs (one past the highest chunk it has
+// acked), so driveSnapshotInstall can resume a partially-transferred
+// snapshot after a follower crash instead of restarting at chunk 0 every
+// time. The progress lives in the leader's in-memory cache and is lost if
+// the leader restarts.
+func snapshotProgressCacheKey(group uint64, peerId uint64) string {
+	return fmt.Sprint(group, "-snapshot-progress-", peerId)
+}
+
+func (s *BFTRaftServer) snapshotProgress(group uint64, peerId uint64) int {
+	if cached, found := s.GroupsPeers.Get(snapshotProgressCacheKey(group, peerId)); found {
+		return cached.(int)
+	}
+	return 0
+}
+
+func (s *BFTRaftServer) setSnapshotProgress(group uint64, peerId uint64, nextChunkIndex int) {
+	s.GroupsPeers.Set(snapshotProgressCacheKey(group, peerId), nextChunkIndex, cache.DefaultExpiration)
+}
+
+func (s *BFTRaftServer) clearSnapshotProgress(group uint64, peerId uint64) {
+	s.GroupsPeers.Delete(snapshotProgressCacheKey(group, peerId))
+}
+
+// BuildSnapshot serializes the group's current state machine into a single
+// blob, chunks it, and rolls a Merkle hash over the chunks so a follower can
+// verify and resume a partially-transferred snapshot after a crash. It is
+// meant to run in the background, triggered by log size, well before any
+// peer actually needs it.
+func (s *BFTRaftServer) BuildSnapshot(group *pb.RaftGroup) (*SnapshotMeta, error) {
+	lastEntry := s.LastLogEntry(group.Id)
+	stateData, err := s.SerializeStateMachine(group.Id)
+	if err != nil {
+		return nil, err
+	}
+	var chunkHashes [][]byte
+	for offset := 0; offset < len(stateData); offset += snapshotChunkSize {
+		end := offset + snapshotChunkSize
+		if end > len(stateData) {
+			end = len(stateData)
+		}
+		h := sha256.Sum256(stateData[offset:end])
+		chunkHashes = append(chunkHashes, h[:])
+	}
+	root := sha256.New()
+	for _, h := range chunkHashes {
+		root.Write(h)
+	}
+	stateRoot := root.Sum(nil)
+	meta := &SnapshotMeta{
+		Group:             group.Id,
+		LastIncludedIndex: lastEntry.Index,
+		LastIncludedTerm:  lastEntry.Term,
+		StateRoot:         stateRoot,
+		ChunkHashes:       chunkHashes,
+		TotalSize:         int64(len(stateData)),
+		QuorumSignatures:  s.collectRootQuorumCert(group.Id, s.GetGroupPeers(group.Id), stateRoot),
+	}
+	s.GroupsPeers.Set(snapshotCacheKey(group.Id), meta, cache.DefaultExpiration)
+	s.GroupsPeers.Set(snapshotDataCacheKey(group.Id), stateData, cache.DefaultExpiration)
+	return meta, nil
+}
+
+// MaybeBuildSnapshot triggers BuildSnapshot when the group's log has grown
+// past snapshotLagThreshold entries since the last snapshot, so a snapshot
+// is usually ready well before a follower falls far enough behind to need
+// one.
+func (s *BFTRaftServer) MaybeBuildSnapshot(group *pb.RaftGroup) {
+	lastEntry := s.LastLogEntry(group.Id)
+	cached, found := s.GroupsPeers.Get(snapshotCacheKey(group.Id))
+	if found {
+		meta := cached.(*SnapshotMeta)
+		if lastEntry.Index-meta.LastIncludedIndex < snapshotLagThreshold {
+			return
+		}
+	}
+	go s.BuildSnapshot(group)
+}
+
+// InstallSnapshot streams chunk chunkIndex of the group's current snapshot
+// to peer, returning false once every chunk has been sent so the caller
+// knows to resume normal AppendEntries replication from
+// meta.LastIncludedIndex+1.
+func (s *BFTRaftServer) InstallSnapshot(ctx context.Context, group *pb.RaftGroup, peer *pb.Peer, chunkIndex int) (*pb.InstallSnapshotResponse, bool, error) {
+	cached, found := s.GroupsPeers.Get(snapshotCacheKey(group.Id))
+	if !found {
+		return nil, false, fmt.Errorf("no snapshot built for group %d yet", group.Id)
+	}
+	meta := cached.(*SnapshotMeta)
+	if chunkIndex >= len(meta.ChunkHashes) {
+		return nil, false, fmt.Errorf("chunk %d out of range for group %d snapshot", chunkIndex, group.Id)
+	}
+	dataCached, _ := s.GroupsPeers.Get(snapshotDataCacheKey(group.Id))
+	stateData := dataCached.([]byte)
+	offset := chunkIndex * snapshotChunkSize
+	end := offset + snapshotChunkSize
+	if end > len(stateData) {
+		end = len(stateData)
+	}
+	chunk := stateData[offset:end]
+	node := s.GetNode(peer.Host)
+	if node == nil {
+		return nil, false, fmt.Errorf("unknown node for peer %d", peer.Host)
+	}
+	client, err := s.ClusterClients.Get(node.ServerAddr)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := client.rpc.InstallSnapshot(ctx, &pb.InstallSnapshotRequest{
+		Group:             group.Id,
+		Term:              group.Term,
+		LeaderId:          s.Id,
+		LastIncludedIndex: meta.LastIncludedIndex,
+		LastIncludedTerm:  meta.LastIncludedTerm,
+		StateRoot:         meta.StateRoot,
+		ChunkIndex:        uint32(chunkIndex),
+		ChunkHash:         meta.ChunkHashes[chunkIndex],
+		Data:              chunk,
+		QuorumSignatures:  meta.QuorumSignatures,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return res, chunkIndex+1 < len(meta.ChunkHashes), nil
+}
+
+// ShouldSnapshot reports whether peer is far enough behind the leader that
+// SendPeerUncommittedLogEntries should fall back to a chunked snapshot
+// install instead of walking the reversed log iterator back to
+// peer.NextIndex.
+func (s *BFTRaftServer) ShouldSnapshot(group *pb.RaftGroup, peer *pb.Peer) bool {
+	lastEntry := s.LastLogEntry(group.Id)
+	if peer.NextIndex >= lastEntry.Index {
+		return false
+	}
+	return lastEntry.Index-peer.NextIndex > snapshotLagThreshold
+}
+
+// driveSnapshotInstall streams every chunk of the group's current snapshot
+// to peer in order, then advances peer.NextIndex past the snapshot so the
+// next SendPeerUncommittedLogEntries call resumes with normal AppendEntries
+// from lastIncludedIndex+1. It resumes from the chunk after the last one peer
+// is known to have acked rather than always restarting at chunk 0, so a
+// follower that crashes mid-transfer does not have to re-download chunks it
+// already has.
+func (s *BFTRaftServer) driveSnapshotInstall(ctx context.Context, group *pb.RaftGroup, peer *pb.Peer) {
+	chunkIndex := s.snapshotProgress(group.Id, peer.Host)
+	for {
+		res, more, err := s.InstallSnapshot(ctx, group, peer, chunkIndex)
+		if err != nil {
+			// Leave progress at the first unacked chunk so a later call
+			// resumes here instead of from the beginning.
+			return
+		}
+		if res != nil && !res.Success {
+			return
+		}
+		s.setSnapshotProgress(group.Id, peer.Host, chunkIndex+1)
+		if !more {
+			break
+		}
+		chunkIndex++
+	}
+	if cached, found := s.GroupsPeers.Get(snapshotCacheKey(group.Id)); found {
+		peer.NextIndex = cached.(*SnapshotMeta).LastIncludedIndex + 1
+		s.clearSnapshotProgress(group.Id, peer.Host)
+	}
+}
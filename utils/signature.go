@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+)
+
+// VerifySignature checks an RSA PKCS#1 v1.5 signature over data against a
+// DER-encoded (PKIX) public key, returning false on any parse or
+// verification failure rather than propagating an error, since callers only
+// ever need a yes/no trust decision.
+func VerifySignature(pubKeyDER []byte, data []byte, signature []byte) bool {
+	pub, err := x509.ParsePKIXPublicKey(pubKeyDER)
+	if err != nil {
+		return false
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return false
+	}
+	hashed := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, hashed[:], signature) == nil
+}
+
+// ExecCommandResponseSignData returns the bytes a CommandResponse's
+// signature must cover: enough of the original request plus a hash of the
+// result that a client can catch a response being silently swapped for one
+// belonging to a different request.
+func ExecCommandResponseSignData(groupId uint64, clientId uint64, requestId uint64, funcId uint64, argHash uint64, resultHash uint64) []byte {
+	buf := make([]byte, 48)
+	binary.LittleEndian.PutUint64(buf[0:8], groupId)
+	binary.LittleEndian.PutUint64(buf[8:16], clientId)
+	binary.LittleEndian.PutUint64(buf[16:24], requestId)
+	binary.LittleEndian.PutUint64(buf[24:32], funcId)
+	binary.LittleEndian.PutUint64(buf[32:40], argHash)
+	binary.LittleEndian.PutUint64(buf[40:48], resultHash)
+	return buf
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+)
+
+// TestExecCommandResponseSignDataRoundTrips proves the signing scheme
+// server.ExecCommand uses to sign a CommandResponse is exactly what
+// client.verifyCommandResponse checks against, so the two sides can never
+// silently drift apart.
+func TestExecCommandResponseSignDataRoundTrips(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal pub key: %v", err)
+	}
+
+	argHash := HashData([]byte("arg"))
+	resultHash := HashData([]byte("result"))
+	signData := ExecCommandResponseSignData(1, 2, 3, 4, argHash, resultHash)
+	hashed := sha256.Sum256(signData)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if !VerifySignature(pubDER, signData, sig) {
+		t.Fatal("expected VerifySignature to accept a signature produced over the same sign data")
+	}
+}
+
+// TestExecCommandResponseSignDataRejectsMismatchedResult makes sure a
+// response whose result was swapped after signing (or that was signed for a
+// different request) fails verification, since that is the whole point of
+// including argHash/resultHash/requestId in the signed bytes.
+func TestExecCommandResponseSignDataRejectsMismatchedResult(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal pub key: %v", err)
+	}
+
+	argHash := HashData([]byte("arg"))
+	signData := ExecCommandResponseSignData(1, 2, 3, 4, argHash, HashData([]byte("result")))
+	hashed := sha256.Sum256(signData)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	tamperedSignData := ExecCommandResponseSignData(1, 2, 3, 4, argHash, HashData([]byte("different result")))
+	if VerifySignature(pubDER, tamperedSignData, sig) {
+		t.Fatal("expected VerifySignature to reject a signature whose result hash no longer matches")
+	}
+}